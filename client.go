@@ -1,12 +1,472 @@
 package crud
 
-//IClient to access CRUD services
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/store"
+)
+
+//IClient is implemented by Client, kept as an interface so callers can mock the CRUD client in tests
 type IClient interface {
 	Server() string //server address
-	//Auth()...
+	Auth(a Auth) Client
+
+	Store(name string) (StoreClient, error)
+	Oper(path string) (OperClient, error)
+}
+
+//NewClient creates a client talking to the CRUD/opers server at baseURL over HTTP/JSON.
+//Use WithTransport() to replace the transport, e.g. with gRPC or an in-process one.
+func NewClient(baseURL string) Client {
+	return Client{
+		baseURL:   baseURL,
+		transport: NewHTTPTransport(baseURL),
+		stores:    make(map[string]reflect.Type),
+		opers:     make(map[string]operTypes),
+	}
+}
+
+//Client is immutable once built: every With...()/Auth() call returns a modified copy,
+//so a single Client (and the StoreClient/OperClient handles it hands out) may safely
+//be shared across goroutines.
+type Client struct {
+	baseURL   string
+	transport Transport
+	auth      Auth
+	before    []RequestMiddleware
+	after     []ResponseMiddleware
+	retry     RetryPolicy
+	stores    map[string]reflect.Type
+	opers     map[string]operTypes
+}
+
+type operTypes struct {
+	requestType  reflect.Type
+	responseType reflect.Type
+}
+
+//Server address this client talks to
+func (c Client) Server() string {
+	return c.baseURL
+}
+
+//WithTransport overrides the default HTTP/JSON transport
+func (c Client) WithTransport(t Transport) Client {
+	c.transport = t
+	return c
+}
+
+//Auth attaches bearer/basic (or custom) credentials to every request made with this client
+func (c Client) Auth(a Auth) Client {
+	c.auth = a
+	return c
+}
+
+//WithMiddleware appends a request and/or response interceptor, applied in the order added
+func (c Client) WithMiddleware(before RequestMiddleware, after ResponseMiddleware) Client {
+	if before != nil {
+		c.before = append(append([]RequestMiddleware{}, c.before...), before)
+	}
+	if after != nil {
+		c.after = append(append([]ResponseMiddleware{}, c.after...), after)
+	}
+	return c
+}
+
+//WithRetry sets the retry-with-backoff policy used on transport errors and 5xx responses
+func (c Client) WithRetry(r RetryPolicy) Client {
+	c.retry = r
+	return c
+}
+
+//WithStore registers name as a store of the given item type, so Store(name) can hand out a typed handle
+func (c Client) WithStore(name string, itemType reflect.Type) Client {
+	stores := make(map[string]reflect.Type, len(c.stores)+1)
+	for k, v := range c.stores {
+		stores[k] = v
+	}
+	stores[name] = itemType
+	c.stores = stores
+	return c
+}
+
+//WithOper registers path as a custom operation with the given request/response types,
+//so Oper(path) can hand out a typed handle
+func (c Client) WithOper(path string, requestType, responseType reflect.Type) Client {
+	opers := make(map[string]operTypes, len(c.opers)+1)
+	for k, v := range c.opers {
+		opers[k] = v
+	}
+	opers[path] = operTypes{requestType: requestType, responseType: responseType}
+	c.opers = opers
+	return c
+}
+
+//Store returns a typed handle to a store registered with WithStore()
+func (c Client) Store(name string) (StoreClient, error) {
+	itemType, ok := c.stores[name]
+	if !ok {
+		return StoreClient{}, errors.Errorf("store %q not registered, call WithStore() first", name)
+	}
+	return StoreClient{client: c, name: name, itemType: itemType}, nil
+}
+
+//Oper returns a typed handle to an operation registered with WithOper()
+func (c Client) Oper(path string) (OperClient, error) {
+	types, ok := c.opers[path]
+	if !ok {
+		return OperClient{}, errors.Errorf("oper %q not registered, call WithOper() first", path)
+	}
+	return OperClient{client: c, path: path, requestType: types.requestType, responseType: types.responseType}, nil
+}
+
+//do marshals body (if any), runs auth/middleware/retry and invokes the transport.
+//A response with status 400 or above is returned alongside an error so callers that need the raw
+//status/body (e.g. to decode a structured error) still have it.
+func (c Client) do(ctx context.Context, method, path string, body interface{}, header http.Header) (TransportResponse, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return TransportResponse{}, errors.Wrapf(err, "failed to encode request")
+		}
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	if bodyBytes != nil {
+		header.Set("Content-Type", "application/json")
+	}
+	if c.auth != nil {
+		c.auth.SetAuth(header)
+	}
+
+	tr := TransportRequest{Method: method, Path: path, Header: header, Body: bodyBytes}
+	for _, m := range c.before {
+		m(&tr)
+	}
+
+	maxAttempts := c.retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := c.retry.Backoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+
+	var res TransportResponse
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		res, err = c.transport.Do(ctx, tr)
+		if err == nil && res.StatusCode < http.StatusInternalServerError {
+			break
+		}
+		if attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-ctx.Done():
+			return TransportResponse{}, ctx.Err()
+		}
+	}
+	if err != nil {
+		return TransportResponse{}, errors.Wrapf(err, "%s %s", method, path)
+	}
+	for _, m := range c.after {
+		m(&res)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return res, errors.Errorf("%s %s: (%d) %s", method, path, res.StatusCode, strings.TrimSpace(string(res.Body)))
+	}
+	return res, nil
+}
+
+//Transport performs the request/response exchange for a Client. The default is
+//NewHTTPTransport(); implement this to add a gRPC or in-process transport.
+type Transport interface {
+	Do(ctx context.Context, req TransportRequest) (TransportResponse, error)
+}
+
+//TransportRequest is a transport-agnostic description of one call
+type TransportRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+//TransportResponse is a transport-agnostic description of one reply
+type TransportResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+//HTTPTransport is the default Transport, issuing one *http.Request per call
+type HTTPTransport struct {
+	baseURL string
+	http    *http.Client
+}
+
+//NewHTTPTransport ...
+func NewHTTPTransport(baseURL string) *HTTPTransport {
+	return &HTTPTransport{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{},
+	}
+}
+
+//Do implements Transport
+func (t *HTTPTransport) Do(ctx context.Context, tr TransportRequest) (TransportResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, tr.Method, t.baseURL+tr.Path, bytes.NewReader(tr.Body))
+	if err != nil {
+		return TransportResponse{}, errors.Wrapf(err, "failed to build request")
+	}
+	for k, values := range tr.Header {
+		for _, v := range values {
+			httpReq.Header.Add(k, v)
+		}
+	}
+
+	httpRes, err := t.http.Do(httpReq)
+	if err != nil {
+		return TransportResponse{}, errors.Wrapf(err, "request failed")
+	}
+	defer httpRes.Body.Close()
+	resBody, err := ioutil.ReadAll(httpRes.Body)
+	if err != nil {
+		return TransportResponse{}, errors.Wrapf(err, "failed to read response")
+	}
+	return TransportResponse{StatusCode: httpRes.StatusCode, Header: httpRes.Header, Body: resBody}, nil
+}
 
-	Add() error
-	Get()
-	Upd()
-	Del()
+//Auth attaches credentials to an outgoing request's header
+type Auth interface {
+	SetAuth(header http.Header)
 }
+
+//BearerAuth sets an "Authorization: Bearer <token>" header
+type BearerAuth string
+
+//SetAuth implements Auth
+func (a BearerAuth) SetAuth(header http.Header) {
+	header.Set("Authorization", "Bearer "+string(a))
+}
+
+//BasicAuth sets an "Authorization: Basic <...>" header
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+//SetAuth implements Auth
+func (a BasicAuth) SetAuth(header http.Header) {
+	token := base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))
+	header.Set("Authorization", "Basic "+token)
+}
+
+//RequestMiddleware can inspect/modify a request before it is sent
+type RequestMiddleware func(req *TransportRequest)
+
+//ResponseMiddleware can inspect/modify a response after it is received
+type ResponseMiddleware func(res *TransportResponse)
+
+//RetryPolicy controls retries of failed/5xx calls. The zero value makes one attempt with no retry.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration //attempt starts at 1
+}
+
+func defaultBackoff(attempt int) time.Duration {
+	return time.Duration(attempt) * 100 * time.Millisecond
+}
+
+//StoreClient is a typed handle to one store, obtained with Client.Store()
+type StoreClient struct {
+	client   Client
+	name     string
+	itemType reflect.Type
+	ctx      context.Context
+}
+
+//WithContext returns a copy of s bound to ctx, e.g. to apply a deadline to the calls that follow
+func (s StoreClient) WithContext(ctx context.Context) StoreClient {
+	s.ctx = ctx
+	return s
+}
+
+func (s StoreClient) context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+//Add creates v and returns the server-assigned store.Info
+func (s StoreClient) Add(v interface{}) (store.Info, error) {
+	res, err := s.client.do(s.context(), http.MethodPost, "/"+s.name, v, nil)
+	if err != nil {
+		return store.Info{}, err
+	}
+	var info store.Info
+	if err := json.Unmarshal(res.Body, &info); err != nil {
+		return store.Info{}, errors.Wrapf(err, "failed to decode response")
+	}
+	return info, nil
+}
+
+//Get fetches the item by id
+func (s StoreClient) Get(id store.ID) (interface{}, store.Info, error) {
+	res, err := s.client.do(s.context(), http.MethodGet, "/"+s.name+"/"+string(id), nil, nil)
+	if err != nil {
+		return nil, store.Info{}, err
+	}
+	itemPtr := reflect.New(s.itemType)
+	if err := json.Unmarshal(res.Body, itemPtr.Interface()); err != nil {
+		return nil, store.Info{}, errors.Wrapf(err, "failed to decode response")
+	}
+	return itemPtr.Elem().Interface(), infoFromHeader(res.Header), nil
+}
+
+//Update replaces the item at rev with v, failing with a conflict error if rev is stale
+func (s StoreClient) Update(id store.ID, rev int, v interface{}) (store.Info, error) {
+	header := make(http.Header)
+	header.Set("If-Match", strconv.Itoa(rev))
+	res, err := s.client.do(s.context(), http.MethodPut, "/"+s.name+"/"+string(id), v, header)
+	if err != nil {
+		return store.Info{}, err
+	}
+	return infoFromHeader(res.Header), nil
+}
+
+//Delete removes the item at rev, failing with a conflict error if rev is stale
+func (s StoreClient) Delete(id store.ID, rev int) error {
+	header := make(http.Header)
+	header.Set("If-Match", strconv.Itoa(rev))
+	_, err := s.client.do(s.context(), http.MethodDelete, "/"+s.name+"/"+string(id), nil, header)
+	return err
+}
+
+//ListQuery selects, sorts and pages a StoreClient.List() call; the zero value lists
+//everything using the server's default page size
+type ListQuery struct {
+	Filter string //"field:op:value", e.g. "age:gt:18"
+	Sort   string //"field,-otherfield"
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+//ListPage is one page of a StoreClient.List() call
+type ListPage struct {
+	Items []interface{}
+	Next  string //non-empty when more results remain; feed back into ListQuery.Cursor
+	Total int
+}
+
+//List returns one page of items matching q
+func (s StoreClient) List(q ListQuery) (ListPage, error) {
+	query := url.Values{}
+	if q.Filter != "" {
+		query.Set("filter", q.Filter)
+	}
+	if q.Sort != "" {
+		query.Set("sort", q.Sort)
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		query.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+	path := "/" + s.name
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	res, err := s.client.do(s.context(), http.MethodGet, path, nil, nil)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	var raw struct {
+		Items []json.RawMessage `json:"items"`
+		Next  string            `json:"next"`
+		Total int               `json:"total"`
+	}
+	if err := json.Unmarshal(res.Body, &raw); err != nil {
+		return ListPage{}, errors.Wrapf(err, "failed to decode response")
+	}
+
+	items := make([]interface{}, len(raw.Items))
+	for i, rawItem := range raw.Items {
+		itemPtr := reflect.New(s.itemType)
+		if err := json.Unmarshal(rawItem, itemPtr.Interface()); err != nil {
+			return ListPage{}, errors.Wrapf(err, "failed to decode item %d", i)
+		}
+		items[i] = itemPtr.Elem().Interface()
+	}
+	return ListPage{Items: items, Next: raw.Next, Total: raw.Total}, nil
+}
+
+func infoFromHeader(header http.Header) store.Info {
+	rev, _ := strconv.Atoi(header.Get("Item-Revision"))
+	ts, _ := time.Parse(timestampFormat, header.Get("Item-Timestamp"))
+	return store.Info{
+		ID:        store.ID(header.Get("Item-ID")),
+		UserID:    store.ID(header.Get("Item-User-ID")),
+		Timestamp: ts,
+		Rev:       rev,
+	}
+}
+
+//OperClient is a typed handle to one custom operation, obtained with Client.Oper()
+type OperClient struct {
+	client       Client
+	path         string
+	requestType  reflect.Type
+	responseType reflect.Type
+	ctx          context.Context
+}
+
+//WithContext returns a copy of o bound to ctx, e.g. to apply a deadline to the call that follows
+func (o OperClient) WithContext(ctx context.Context) OperClient {
+	o.ctx = ctx
+	return o
+}
+
+//Call invokes the operation with req and decodes the response into the registered response type
+func (o OperClient) Call(req interface{}) (interface{}, error) {
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	res, err := o.client.do(ctx, http.MethodPost, o.path, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	responsePtr := reflect.New(o.responseType)
+	if err := json.Unmarshal(res.Body, responsePtr.Interface()); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode response")
+	}
+	return responsePtr.Elem().Interface(), nil
+}
+
+var _ IClient = Client{}
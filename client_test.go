@@ -0,0 +1,163 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/store"
+)
+
+//fakeTransport is a Transport double that returns canned responses and records every
+//request it was called with, so Client's header/body/retry plumbing can be tested
+//without a real HTTP server
+type fakeTransport struct {
+	responses []TransportResponse
+	errors    []error
+	calls     []TransportRequest
+}
+
+func (t *fakeTransport) Do(ctx context.Context, req TransportRequest) (TransportResponse, error) {
+	i := len(t.calls)
+	t.calls = append(t.calls, req)
+	var res TransportResponse
+	var err error
+	if i < len(t.responses) {
+		res = t.responses[i]
+	}
+	if i < len(t.errors) {
+		err = t.errors[i]
+	}
+	return res, err
+}
+
+type clientTestItem struct {
+	Name string `json:"name"`
+}
+
+func TestStoreClientAddSetsContentTypeAndDecodesInfo(t *testing.T) {
+	transport := &fakeTransport{
+		responses: []TransportResponse{
+			{StatusCode: http.StatusOK, Body: []byte(`{"ID":"1","Rev":1}`)},
+		},
+	}
+	client := NewClient("http://example.test").
+		WithTransport(transport).
+		WithStore("item", reflect.TypeOf(clientTestItem{}))
+
+	storeClient, err := client.Store("item")
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	info, err := storeClient.Add(clientTestItem{Name: "a"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if info.ID != "1" || info.Rev != 1 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	if len(transport.calls) != 1 {
+		t.Fatalf("expected exactly one transport call, got %d", len(transport.calls))
+	}
+	call := transport.calls[0]
+	if call.Method != http.MethodPost || call.Path != "/item" {
+		t.Fatalf("unexpected request: %s %s", call.Method, call.Path)
+	}
+	if call.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON Content-Type, got %q", call.Header.Get("Content-Type"))
+	}
+	var sent clientTestItem
+	if err := json.Unmarshal(call.Body, &sent); err != nil {
+		t.Fatalf("decode sent body: %v", err)
+	}
+	if sent.Name != "a" {
+		t.Fatalf("unexpected sent body: %+v", sent)
+	}
+}
+
+func TestStoreClientUpdateSetsIfMatch(t *testing.T) {
+	transport := &fakeTransport{
+		responses: []TransportResponse{{StatusCode: http.StatusOK, Header: http.Header{"Item-Revision": []string{"2"}}}},
+	}
+	client := NewClient("http://example.test").
+		WithTransport(transport).
+		WithStore("item", reflect.TypeOf(clientTestItem{}))
+	storeClient, _ := client.Store("item")
+
+	info, err := storeClient.Update(store.ID("1"), 1, clientTestItem{Name: "b"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if info.Rev != 2 {
+		t.Fatalf("expected Rev 2 from Item-Revision header, got %d", info.Rev)
+	}
+	if got := transport.calls[0].Header.Get("If-Match"); got != "1" {
+		t.Fatalf(`expected If-Match "1", got %q`, got)
+	}
+}
+
+func TestClientAuthSetsAuthorizationHeader(t *testing.T) {
+	transport := &fakeTransport{responses: []TransportResponse{{StatusCode: http.StatusOK, Body: []byte(`{}`)}}}
+	client := NewClient("http://example.test").
+		WithTransport(transport).
+		WithStore("item", reflect.TypeOf(clientTestItem{})).
+		Auth(BearerAuth("secret-token"))
+	storeClient, _ := client.Store("item")
+
+	if _, err := storeClient.Add(clientTestItem{Name: "a"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if got := transport.calls[0].Header.Get("Authorization"); got != "Bearer secret-token" {
+		t.Fatalf("unexpected Authorization header: %q", got)
+	}
+}
+
+func TestClientRetriesOn5xxThenSucceeds(t *testing.T) {
+	transport := &fakeTransport{
+		responses: []TransportResponse{
+			{StatusCode: http.StatusInternalServerError, Body: []byte("boom")},
+			{StatusCode: http.StatusOK, Body: []byte(`{}`)},
+		},
+	}
+	client := NewClient("http://example.test").
+		WithTransport(transport).
+		WithStore("item", reflect.TypeOf(clientTestItem{})).
+		WithRetry(RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }})
+	storeClient, _ := client.Store("item")
+
+	if _, err := storeClient.Add(clientTestItem{Name: "a"}); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if len(transport.calls) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(transport.calls))
+	}
+}
+
+func TestClientDoesNotRetryOn4xx(t *testing.T) {
+	transport := &fakeTransport{
+		responses: []TransportResponse{{StatusCode: http.StatusBadRequest, Body: []byte("nope")}},
+	}
+	client := NewClient("http://example.test").
+		WithTransport(transport).
+		WithStore("item", reflect.TypeOf(clientTestItem{})).
+		WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: func(int) time.Duration { return 0 }})
+	storeClient, _ := client.Store("item")
+
+	if _, err := storeClient.Add(clientTestItem{Name: "a"}); err == nil {
+		t.Fatalf("expected a 400 to surface as an error")
+	}
+	if len(transport.calls) != 1 {
+		t.Fatalf("expected no retry on a 4xx, got %d calls", len(transport.calls))
+	}
+}
+
+func TestStoreReturnsErrorWhenNotRegistered(t *testing.T) {
+	client := NewClient("http://example.test")
+	if _, err := client.Store("missing"); err == nil {
+		t.Fatalf("expected an error for an unregistered store")
+	}
+}
@@ -0,0 +1,122 @@
+package crud
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-msvc/errors"
+	"github.com/golang/protobuf/proto"
+)
+
+//Codec marshals/unmarshals request and response bodies for one content type, so the
+//same handlers can serve JSON browsers, YAML-friendly CLI tools and protobuf clients
+//without duplicating logic
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+func defaultCodecs() map[string]Codec {
+	return map[string]Codec{
+		"application/json":       jsonCodec{},
+		"application/yaml":       yamlCodec{},
+		"application/x-protobuf": protobufCodec{},
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                       { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+//yamlCodec round-trips through encoding/json so it honors the same "json" struct tags
+//already used for the JSON codec and the OpenAPI schema
+type yamlCodec struct{}
+
+func (yamlCodec) ContentType() string                       { return "application/yaml" }
+func (yamlCodec) Marshal(v interface{}) ([]byte, error)      { return yaml.Marshal(v) }
+func (yamlCodec) Unmarshal(data []byte, v interface{}) error { return yaml.Unmarshal(data, v) }
+
+//protobufCodec requires the registered store/oper type to implement proto.Message
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("%T does not implement proto.Message, cannot encode as protobuf", v)
+	}
+	return proto.Marshal(message)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("%T does not implement proto.Message, cannot decode protobuf", v)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+//codecForContentType picks the codec to decode a request body with, defaulting to JSON
+//when Content-Type is absent or unregistered
+func (server Server) codecForContentType(header string) Codec {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "" {
+		return jsonCodec{}
+	}
+	if codec, ok := server.codecs[mediaType]; ok {
+		return codec
+	}
+	return jsonCodec{}
+}
+
+//codecForAccept picks the codec to encode a response with: the first acceptable,
+//registered content type in Accept, defaulting to JSON
+func (server Server) codecForAccept(header string) Codec {
+	if header == "" {
+		return jsonCodec{}
+	}
+	for _, accepted := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || mediaType == "*/*" {
+			continue
+		}
+		if codec, ok := server.codecs[mediaType]; ok {
+			return codec
+		}
+	}
+	return jsonCodec{}
+}
+
+//decodeBody reads req.Body and unmarshals it into v using the codec selected by Content-Type
+func (server Server) decodeBody(req *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read request body")
+	}
+	codec := server.codecForContentType(req.Header.Get("Content-Type"))
+	if err := codec.Unmarshal(body, v); err != nil {
+		return errors.Wrapf(err, "failed to decode %s body", codec.ContentType())
+	}
+	return nil
+}
+
+//writeBody marshals v using the codec selected by Accept and writes it with statusCode
+func (server Server) writeBody(res http.ResponseWriter, req *http.Request, statusCode int, v interface{}) {
+	codec := server.codecForAccept(req.Header.Get("Accept"))
+	body, err := codec.Marshal(v)
+	if err != nil {
+		http.Error(res, errors.Wrapf(err, "failed to encode response").Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", codec.ContentType())
+	res.WriteHeader(statusCode)
+	res.Write(body)
+}
@@ -0,0 +1,98 @@
+package crud
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCodecForContentTypeDefaultsToJSON(t *testing.T) {
+	server := New()
+	cases := []string{"", "not/a-valid-type;=", "text/plain"}
+	for _, header := range cases {
+		if codec := server.codecForContentType(header); codec.ContentType() != "application/json" {
+			t.Fatalf("codecForContentType(%q) = %q, want application/json", header, codec.ContentType())
+		}
+	}
+}
+
+func TestCodecForContentTypePicksRegisteredCodec(t *testing.T) {
+	server := New()
+	if codec := server.codecForContentType("application/yaml"); codec.ContentType() != "application/yaml" {
+		t.Fatalf("expected the yaml codec, got %q", codec.ContentType())
+	}
+	if codec := server.codecForContentType("application/yaml; charset=utf-8"); codec.ContentType() != "application/yaml" {
+		t.Fatalf("expected media-type parameters to be ignored, got %q", codec.ContentType())
+	}
+}
+
+func TestCodecForAcceptDefaultsToJSON(t *testing.T) {
+	server := New()
+	if codec := server.codecForAccept(""); codec.ContentType() != "application/json" {
+		t.Fatalf("expected default json for an empty Accept, got %q", codec.ContentType())
+	}
+	if codec := server.codecForAccept("*/*"); codec.ContentType() != "application/json" {
+		t.Fatalf("expected default json for Accept: */*, got %q", codec.ContentType())
+	}
+}
+
+func TestCodecForAcceptPicksFirstRegisteredMatch(t *testing.T) {
+	server := New()
+	codec := server.codecForAccept("application/x-protobuf, application/yaml")
+	if codec.ContentType() != "application/x-protobuf" {
+		t.Fatalf("expected the first acceptable registered type, got %q", codec.ContentType())
+	}
+}
+
+func TestWithCodecOverridesOrAddsACodec(t *testing.T) {
+	server := New().WithCodec(fakeCodec{})
+	if codec := server.codecForContentType("application/x-fake"); codec.ContentType() != "application/x-fake" {
+		t.Fatalf("expected WithCodec to register a new content type, got %q", codec.ContentType())
+	}
+}
+
+type fakeCodec struct{}
+
+func (fakeCodec) ContentType() string                       { return "application/x-fake" }
+func (fakeCodec) Marshal(v interface{}) ([]byte, error)      { return []byte("fake"), nil }
+func (fakeCodec) Unmarshal(data []byte, v interface{}) error { return nil }
+
+func TestDecodeBodyUsesContentTypeCodec(t *testing.T) {
+	server := New()
+	req := httptest.NewRequest("POST", "/item", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	var item testItem
+	if err := server.decodeBody(req, &item); err != nil {
+		t.Fatalf("decodeBody: %v", err)
+	}
+	if item.Name != "a" {
+		t.Fatalf("unexpected decoded item: %+v", item)
+	}
+}
+
+func TestWriteBodyUsesAcceptCodec(t *testing.T) {
+	server := New()
+	req := httptest.NewRequest("GET", "/item", nil)
+	req.Header.Set("Accept", "application/yaml")
+	res := httptest.NewRecorder()
+
+	server.writeBody(res, req, 200, testItem{Name: "a"})
+
+	if ct := res.Header().Get("Content-Type"); ct != "application/yaml" {
+		t.Fatalf("expected application/yaml, got %q", ct)
+	}
+	if res.Code != 200 {
+		t.Fatalf("expected the given status code to be written, got %d", res.Code)
+	}
+}
+
+func TestProtobufCodecRejectsNonProtoMessage(t *testing.T) {
+	codec := protobufCodec{}
+	if _, err := codec.Marshal(testItem{Name: "a"}); err == nil {
+		t.Fatalf("expected an error marshaling a non-proto.Message value")
+	}
+	if err := codec.Unmarshal([]byte{}, &testItem{}); err == nil {
+		t.Fatalf("expected an error unmarshaling into a non-proto.Message value")
+	}
+}
@@ -0,0 +1,267 @@
+package crud
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/store"
+)
+
+//OpenAPI builds the OpenAPI 3 document describing every registered store and oper.
+//AddToMux serves this at GET /openapi.json; callers that need to post-process it
+//(e.g. to set Info.Version or add a security scheme) can call this directly and
+//serve the result themselves instead.
+func (server Server) OpenAPI() *openapi3.T {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:   "CRUD API",
+			Version: "1.0.0",
+		},
+		Paths:      openapi3.Paths{},
+		Components: openapi3.NewComponents(),
+	}
+	doc.Components.Schemas = make(openapi3.Schemas)
+
+	for _, s := range server.stores {
+		server.addStoreToOpenAPI(doc, s)
+	}
+	for path, info := range server.opers {
+		server.addOperToOpenAPI(doc, path, info)
+	}
+	return doc
+}
+
+func (server Server) addStoreToOpenAPI(doc *openapi3.T, s store.IStore) {
+	itemSchema := schemaForType(s.Type())
+	schemaName := s.Type().Name()
+	doc.Components.Schemas[schemaName] = openapi3.NewSchemaRef("", itemSchema)
+	itemRef := openapi3.NewSchemaRef("#/components/schemas/"+schemaName, itemSchema)
+
+	collectionPath := "/" + s.Name()
+	collectionItem := &openapi3.PathItem{
+		Post: &openapi3.Operation{
+			Summary:     "Create a " + schemaName,
+			RequestBody: jsonRequestBody(itemRef),
+			Responses: openapi3.Responses{
+				"200": jsonResponse("created", openapi3.NewSchemaRef("", schemaForType(reflect.TypeOf(store.Info{})))),
+			},
+		},
+	}
+	if _, ok := s.(IQueryableStore); ok {
+		collectionItem.Get = &openapi3.Operation{
+			Summary: "List " + schemaName,
+			Parameters: openapi3.Parameters{
+				queryParam("limit", "integer"),
+				queryParam("offset", "integer"),
+				queryParam("cursor", "string"),
+				queryParam("sort", "string"),
+				queryParam("filter", "string"),
+			},
+			Responses: openapi3.Responses{
+				"200": jsonResponse("a page of "+schemaName, openapi3.NewSchemaRef("", openapi3.NewObjectSchema())),
+			},
+		}
+	}
+	doc.Paths[collectionPath] = collectionItem
+
+	itemItem := &openapi3.PathItem{
+		Parameters: openapi3.Parameters{pathParam("id")},
+		Get: &openapi3.Operation{
+			Summary: "Get a " + schemaName + " by id",
+			Responses: openapi3.Responses{
+				"200": jsonResponse("", itemRef),
+				"404": textResponse("not found"),
+			},
+		},
+	}
+	if _, ok := s.(IUpdatableStore); ok {
+		itemItem.Put = &openapi3.Operation{
+			Summary:     "Update a " + schemaName,
+			Parameters:  openapi3.Parameters{headerParam("If-Match")},
+			RequestBody: jsonRequestBody(itemRef),
+			Responses: openapi3.Responses{
+				"200": textResponse("updated"),
+				"409": textResponse("stale revision"),
+			},
+		}
+	}
+	if _, ok := s.(IDeletableStore); ok {
+		itemItem.Delete = &openapi3.Operation{
+			Summary:    "Delete a " + schemaName,
+			Parameters: openapi3.Parameters{headerParam("If-Match")},
+			Responses: openapi3.Responses{
+				"200": textResponse("deleted"),
+				"409": textResponse("stale revision"),
+			},
+		}
+	}
+	doc.Paths[collectionPath+"/{id}"] = itemItem
+}
+
+func (server Server) addOperToOpenAPI(doc *openapi3.T, path string, info operInfo) {
+	requestSchemaName := info.requestType.Name()
+	doc.Components.Schemas[requestSchemaName] = openapi3.NewSchemaRef("", schemaForType(info.requestType))
+	requestRef := openapi3.NewSchemaRef("#/components/schemas/"+requestSchemaName, doc.Components.Schemas[requestSchemaName].Value)
+
+	responseSchemaName := info.responseType.Name()
+	doc.Components.Schemas[responseSchemaName] = openapi3.NewSchemaRef("", schemaForType(info.responseType))
+	responseRef := openapi3.NewSchemaRef("#/components/schemas/"+responseSchemaName, doc.Components.Schemas[responseSchemaName].Value)
+
+	doc.Paths[path] = &openapi3.PathItem{
+		Post: &openapi3.Operation{
+			Summary:     "Call " + path,
+			RequestBody: jsonRequestBody(requestRef),
+			Responses: openapi3.Responses{
+				"200": jsonResponse("", responseRef),
+			},
+		},
+	}
+}
+
+//schemaForType converts a registered item/request/response Go type into a JSON schema,
+//honoring "json", "validate", "description" and "example" struct tags on struct fields
+func schemaForType(t reflect.Type) *openapi3.Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return openapi3.NewStringSchema()
+	case reflect.Bool:
+		return openapi3.NewBoolSchema()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openapi3.NewIntegerSchema()
+	case reflect.Float32, reflect.Float64:
+		return openapi3.NewFloat64Schema()
+	case reflect.Slice, reflect.Array:
+		return openapi3.NewArraySchema().WithItems(schemaForType(t.Elem()))
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return openapi3.NewDateTimeSchema()
+		}
+		schema := openapi3.NewObjectSchema()
+		schema.Properties = make(openapi3.Schemas)
+		required := make([]string, 0)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" { //unexported
+				continue
+			}
+			name := field.Name
+			if jsonTag := field.Tag.Get("json"); jsonTag != "" {
+				tagName := strings.SplitN(jsonTag, ",", 2)[0]
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+			fieldSchema := schemaForType(field.Type)
+			if description := field.Tag.Get("description"); description != "" {
+				fieldSchema.Description = description
+			}
+			if example := field.Tag.Get("example"); example != "" {
+				fieldSchema.Example = example
+			}
+			if validate := field.Tag.Get("validate"); validateHasRule(validate, "required") {
+				required = append(required, name)
+			}
+			schema.Properties[name] = openapi3.NewSchemaRef("", fieldSchema)
+		}
+		schema.Required = required
+		return schema
+	default:
+		return openapi3.NewSchema()
+	}
+}
+
+//validateHasRule reports whether rule appears among the comma-separated rules of a
+//`validate:"..."` struct tag, e.g. validateHasRule("required,email", "required") == true
+func validateHasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonRequestBody(schema *openapi3.SchemaRef) *openapi3.RequestBodyRef {
+	return &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().WithJSONSchemaRef(schema).WithRequired(true),
+	}
+}
+
+func jsonResponse(description string, schema *openapi3.SchemaRef) *openapi3.ResponseRef {
+	return &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().WithDescription(description).WithJSONSchemaRef(schema),
+	}
+}
+
+func textResponse(description string) *openapi3.ResponseRef {
+	return &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().WithDescription(description),
+	}
+}
+
+func queryParam(name, typ string) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{
+		Value: openapi3.NewQueryParameter(name).WithSchema(&openapi3.Schema{Type: typ}),
+	}
+}
+
+func pathParam(name string) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{
+		Value: openapi3.NewPathParameter(name).WithSchema(openapi3.NewStringSchema()),
+	}
+}
+
+func headerParam(name string) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{
+		Value: openapi3.NewHeaderParameter(name).WithSchema(openapi3.NewStringSchema()),
+	}
+}
+
+//GET /openapi.json -> the OpenAPI 3 document for this server
+func (server Server) openAPIHandler() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		jsonValue, err := json.Marshal(server.OpenAPI())
+		if err != nil {
+			http.Error(res, errors.Wrapf(err, "failed to marshal openapi document").Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(jsonValue)
+	}
+}
+
+//GET /openapi/ -> a Swagger UI that renders /openapi.json
+func (server Server) swaggerUIHandler() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte(swaggerUIHTML))
+	}
+}
+
+const swaggerUIHTML = `<!DOCTYPE html>
+<html>
+<head>
+	<title>API docs</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist/swagger-ui-bundle.js"></script>
+	<script>
+		window.onload = () => SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"})
+	</script>
+</body>
+</html>`
@@ -0,0 +1,151 @@
+package crud
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-msvc/store"
+)
+
+type openAPITestItem struct {
+	Name     string   `json:"name" validate:"required" description:"the item's name" example:"widget"`
+	Age      int      `json:"age,omitempty" validate:"min=0"`
+	Internal string   `json:"-"`
+	secret   string   //unexported
+	Tags     []string `json:"tags"`
+}
+
+func TestSchemaForTypeStructFields(t *testing.T) {
+	schema := schemaForType(reflect.TypeOf(openAPITestItem{}))
+	if schema.Type != "object" {
+		t.Fatalf("expected an object schema, got %q", schema.Type)
+	}
+
+	if _, ok := schema.Properties["name"]; !ok {
+		t.Fatalf("expected a %q property, got %v", "name", schema.Properties)
+	}
+	if _, ok := schema.Properties["Internal"]; ok {
+		t.Fatalf(`json:"-" field must be excluded from the schema`)
+	}
+	if _, ok := schema.Properties["secret"]; ok {
+		t.Fatalf("unexported field must be excluded from the schema")
+	}
+	if _, ok := schema.Properties["age"]; !ok {
+		t.Fatalf("expected an %q property from the json tag's name, got %v", "age", schema.Properties)
+	}
+
+	nameSchema := schema.Properties["name"].Value
+	if nameSchema.Description != "the item's name" {
+		t.Fatalf("expected the description tag to be honored, got %q", nameSchema.Description)
+	}
+	if nameSchema.Example != "widget" {
+		t.Fatalf("expected the example tag to be honored, got %v", nameSchema.Example)
+	}
+
+	if len(schema.Required) != 1 || schema.Required[0] != "name" {
+		t.Fatalf(`expected only "name" (validate:"required") in Required, got %v`, schema.Required)
+	}
+}
+
+func TestSchemaForTypePointerAndSlice(t *testing.T) {
+	schema := schemaForType(reflect.TypeOf(&openAPITestItem{}))
+	if schema.Type != "object" {
+		t.Fatalf("expected a pointer-to-struct to resolve to an object schema, got %q", schema.Type)
+	}
+
+	tagsSchema := schema.Properties["tags"].Value
+	if tagsSchema.Type != "array" {
+		t.Fatalf("expected tags to be an array schema, got %q", tagsSchema.Type)
+	}
+	if tagsSchema.Items.Value.Type != "string" {
+		t.Fatalf("expected tags items to be a string schema, got %q", tagsSchema.Items.Value.Type)
+	}
+}
+
+func TestSchemaForTypeScalars(t *testing.T) {
+	cases := map[string]reflect.Type{
+		"string":  reflect.TypeOf(""),
+		"boolean": reflect.TypeOf(true),
+		"integer": reflect.TypeOf(0),
+		"number":  reflect.TypeOf(0.0),
+	}
+	for wantType, t2 := range cases {
+		if got := schemaForType(t2).Type; got != wantType {
+			t.Fatalf("schemaForType(%s) = %q, want %q", t2, got, wantType)
+		}
+	}
+}
+
+func TestValidateHasRule(t *testing.T) {
+	cases := []struct {
+		tag  string
+		rule string
+		want bool
+	}{
+		{"required,email", "required", true},
+		{"required,email", "email", true},
+		{"required,email", "min=3", false},
+		{"", "required", false},
+	}
+	for _, c := range cases {
+		if got := validateHasRule(c.tag, c.rule); got != c.want {
+			t.Fatalf("validateHasRule(%q, %q) = %v, want %v", c.tag, c.rule, got, c.want)
+		}
+	}
+}
+
+//baseOnlyStore implements only the base store.IStore (Add/Get), none of the optional
+//capability interfaces, to pin down addStoreToOpenAPI's per-capability gating
+type baseOnlyStore struct{ items map[store.ID]interface{} }
+
+func newBaseOnlyStore() *baseOnlyStore { return &baseOnlyStore{items: map[store.ID]interface{}{}} }
+
+func (s *baseOnlyStore) Name() string       { return "baseitem" }
+func (s *baseOnlyStore) Type() reflect.Type { return reflect.TypeOf(openAPITestItem{}) }
+func (s *baseOnlyStore) Add(v interface{}) (store.Info, error) {
+	return store.Info{ID: "1"}, nil
+}
+func (s *baseOnlyStore) Get(id store.ID) (interface{}, store.Info, error) {
+	return openAPITestItem{}, store.Info{}, nil
+}
+
+//updatableOnlyStore additionally implements IUpdatableStore, but neither IDeletableStore
+//nor IQueryableStore
+type updatableOnlyStore struct{ *baseOnlyStore }
+
+func newUpdatableOnlyStore() updatableOnlyStore {
+	return updatableOnlyStore{&baseOnlyStore{items: map[store.ID]interface{}{}}}
+}
+func (updatableOnlyStore) Name() string { return "updatableitem" }
+func (updatableOnlyStore) Update(id store.ID, rev int, v interface{}) (store.Info, error) {
+	return store.Info{}, nil
+}
+
+func TestAddStoreToOpenAPIGatesOnCapability(t *testing.T) {
+	plain := newBaseOnlyStore()
+	server := New().With(plain)
+	doc := server.OpenAPI()
+
+	itemPath := doc.Paths["/"+plain.Name()+"/{id}"]
+	if itemPath.Put != nil {
+		t.Fatalf("a store without IUpdatableStore must not get a Put operation")
+	}
+	if itemPath.Delete != nil {
+		t.Fatalf("a store without IDeletableStore must not get a Delete operation")
+	}
+	collectionPath := doc.Paths["/"+plain.Name()]
+	if collectionPath.Get != nil {
+		t.Fatalf("a store without IQueryableStore must not get a list Get operation")
+	}
+
+	updatable := newUpdatableOnlyStore()
+	server2 := New().With(updatable)
+	doc2 := server2.OpenAPI()
+	itemPath2 := doc2.Paths["/"+updatable.Name()+"/{id}"]
+	if itemPath2.Put == nil {
+		t.Fatalf("a store implementing IUpdatableStore must get a Put operation")
+	}
+	if itemPath2.Delete != nil {
+		t.Fatalf("a store not implementing IDeletableStore must not get a Delete operation")
+	}
+}
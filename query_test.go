@@ -0,0 +1,139 @@
+package crud
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageFromQueryDefaults(t *testing.T) {
+	page, err := pageFromQuery(url.Values{})
+	if err != nil {
+		t.Fatalf("pageFromQuery: %v", err)
+	}
+	if page.Limit != defaultPageLimit || page.Offset != 0 || page.Cursor != "" {
+		t.Fatalf("unexpected default page: %+v", page)
+	}
+}
+
+func TestPageFromQueryParsesValues(t *testing.T) {
+	page, err := pageFromQuery(url.Values{
+		"limit":  []string{"10"},
+		"offset": []string{"20"},
+		"cursor": []string{"abc"},
+	})
+	if err != nil {
+		t.Fatalf("pageFromQuery: %v", err)
+	}
+	if page.Limit != 10 || page.Offset != 20 || page.Cursor != "abc" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+}
+
+func TestPageFromQueryRejectsInvalidValues(t *testing.T) {
+	cases := []url.Values{
+		{"limit": []string{"not-a-number"}},
+		{"limit": []string{"-1"}},
+		{"offset": []string{"not-a-number"}},
+		{"offset": []string{"-1"}},
+	}
+	for _, query := range cases {
+		if _, err := pageFromQuery(query); err == nil {
+			t.Fatalf("expected an error for %v", query)
+		}
+	}
+}
+
+func TestSortFromQuery(t *testing.T) {
+	sort, err := sortFromQuery(url.Values{"sort": []string{"name,-age, ,  city "}})
+	if err != nil {
+		t.Fatalf("sortFromQuery: %v", err)
+	}
+	want := []SortField{
+		{Field: "name"},
+		{Field: "age", Desc: true},
+		{Field: "city"},
+	}
+	if !reflect.DeepEqual(sort, want) {
+		t.Fatalf("got %+v, want %+v", sort, want)
+	}
+}
+
+func TestSortFromQueryEmpty(t *testing.T) {
+	sort, err := sortFromQuery(url.Values{})
+	if err != nil {
+		t.Fatalf("sortFromQuery: %v", err)
+	}
+	if sort != nil {
+		t.Fatalf("expected nil sort, got %+v", sort)
+	}
+}
+
+func TestFiltersFromQuery(t *testing.T) {
+	filters, err := filtersFromQuery(url.Values{"filter": []string{"age:gt:18", "name:contains:jo"}})
+	if err != nil {
+		t.Fatalf("filtersFromQuery: %v", err)
+	}
+	want := []Filter{
+		{Field: "age", Op: FilterOpGT, Value: "18"},
+		{Field: "name", Op: FilterOpContains, Value: "jo"},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Fatalf("got %+v, want %+v", filters, want)
+	}
+}
+
+func TestFiltersFromQueryRejectsBadShape(t *testing.T) {
+	if _, err := filtersFromQuery(url.Values{"filter": []string{"age:gt"}}); err == nil {
+		t.Fatalf("expected an error for a filter missing its value")
+	}
+}
+
+func TestFiltersFromQueryRejectsUnknownOp(t *testing.T) {
+	if _, err := filtersFromQuery(url.Values{"filter": []string{"age:between:1:9"}}); err == nil {
+		t.Fatalf("expected an error for an unsupported operator")
+	}
+}
+
+//SplitN(term, ":", 3) means Value is everything after the second ":", so it may itself contain colons
+func TestFiltersFromQueryValueMayContainColons(t *testing.T) {
+	filters, err := filtersFromQuery(url.Values{"filter": []string{"url:eq:http://x"}})
+	if err != nil {
+		t.Fatalf("filtersFromQuery: %v", err)
+	}
+	if len(filters) != 1 || filters[0].Value != "http://x" {
+		t.Fatalf("unexpected filters: %+v", filters)
+	}
+}
+
+//TestStoreListOnlyEmitsNextLink guards against reintroducing a bogus rel="prev" Link
+//header: IQueryableStore.Find only ever returns a forward cursor, so there must never
+//be a prev link, and a next link must only appear when Find actually returned one
+func TestStoreListOnlyEmitsNextLink(t *testing.T) {
+	fake := newFakeStore()
+	server := New().With(fake)
+	if _, err := fake.Add(testItem{Name: "a"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/item?filter=age:gt:18", nil)
+	res := httptest.NewRecorder()
+	server.storeList(fake, res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", res.Code, res.Body.String())
+	}
+	links := res.Header()["Link"]
+	if len(links) != 1 || !strings.Contains(links[0], `rel="next"`) {
+		t.Fatalf(`expected exactly one rel="next" Link header, got %v`, links)
+	}
+	if strings.Contains(links[0], `rel="prev"`) {
+		t.Fatalf(`got a rel="prev" Link header, Find has no prev cursor to build one from: %q`, links[0])
+	}
+	if !strings.Contains(links[0], "filter=") {
+		t.Fatalf("expected the next link to preserve the filter query param: %q", links[0])
+	}
+}
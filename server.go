@@ -1,10 +1,11 @@
 package crud
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/go-msvc/errors"
@@ -17,6 +18,7 @@ func New() Server {
 	return Server{
 		stores: make([]store.IStore, 0),
 		opers:  make(map[string]operInfo),
+		codecs: defaultCodecs(),
 	}
 }
 
@@ -24,6 +26,7 @@ func New() Server {
 type Server struct {
 	stores []store.IStore
 	opers  map[string]operInfo
+	codecs map[string]Codec
 }
 
 //With another store
@@ -33,6 +36,18 @@ func (server Server) With(s store.IStore) Server {
 	return server
 }
 
+//WithCodec registers (or overrides) the codec used for its ContentType(), e.g. to add
+//a content type beyond, or replace one of, the built-in JSON/YAML/protobuf codecs
+func (server Server) WithCodec(c Codec) Server {
+	codecs := make(map[string]Codec, len(server.codecs)+1)
+	for contentType, codec := range server.codecs {
+		codecs[contentType] = codec
+	}
+	codecs[c.ContentType()] = c
+	server.codecs = codecs
+	return server
+}
+
 //WithOper adds a custom operation
 func (server Server) WithOper(path string, oper IOper) Server {
 	//validate the operation to have a Process() method
@@ -41,7 +56,7 @@ func (server Server) WithOper(path string, oper IOper) Server {
 	if !ok {
 		panic(errors.Errorf("%T does not have Process(request)->(response,error) method", oper))
 	}
-	if operProcessMethod.Type.NumIn() != 2 {
+	if operProcessMethod.Type.NumIn() != 2 || operProcessMethod.Type.NumOut() != 2 {
 		panic(errors.Errorf("%T.Process() does not have prototype Process(request)->(response,error)", oper))
 	}
 	operRequestType := operProcessMethod.Type.In(1)
@@ -52,6 +67,7 @@ func (server Server) WithOper(path string, oper IOper) Server {
 		oper:          oper,
 		processMethod: reflect.ValueOf(oper).MethodByName("Process"), //of value, not of type as above :-)
 		requestType:   operRequestType,
+		responseType:  operProcessMethod.Type.Out(0),
 	}
 	return server
 }
@@ -59,17 +75,23 @@ func (server Server) WithOper(path string, oper IOper) Server {
 //AddToMux ...
 func (server Server) AddToMux(mux *http.ServeMux) {
 	for _, s := range server.stores {
-		mux.Handle("/"+s.Name(), server.storeHandler(server.storePost, server.storeGet, s))
-		mux.Handle("/"+s.Name()+"/", server.storeHandler(server.storePost, server.storeGet, s))
+		mux.Handle("/"+s.Name(), server.storeHandler(server.storePost, server.storeGet, server.storeList, server.storeWatch, server.storePut, server.storeDelete, s))
+		mux.Handle("/"+s.Name()+"/", server.storeHandler(server.storePost, server.storeGet, server.storeList, server.storeWatch, server.storePut, server.storeDelete, s))
 	}
 	for operPath, operInfo := range server.opers {
 		mux.Handle(operPath, server.operHandler(server.operPost, operInfo))
 	}
+	mux.Handle("/openapi.json", server.openAPIHandler())
+	mux.Handle("/openapi/", server.swaggerUIHandler())
 }
 
 func (server Server) storeHandler(
 	postFunc func(s store.IStore, res http.ResponseWriter, req *http.Request),
 	getFunc func(s store.IStore, res http.ResponseWriter, req *http.Request),
+	listFunc func(s store.IStore, res http.ResponseWriter, req *http.Request),
+	watchFunc func(s store.IStore, res http.ResponseWriter, req *http.Request),
+	putFunc func(s store.IStore, res http.ResponseWriter, req *http.Request),
+	deleteFunc func(s store.IStore, res http.ResponseWriter, req *http.Request),
 	s store.IStore,
 ) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
@@ -79,14 +101,33 @@ func (server Server) storeHandler(
 			postFunc(s, res, req)
 			return
 		case http.MethodGet:
+			if isCollectionPath(req.URL.Path, s.Name()) {
+				if req.URL.Query().Get("watch") != "" {
+					watchFunc(s, res, req)
+					return
+				}
+				listFunc(s, res, req)
+				return
+			}
 			getFunc(s, res, req)
 			return
+		case http.MethodPut:
+			putFunc(s, res, req)
+			return
+		case http.MethodDelete:
+			deleteFunc(s, res, req)
+			return
 		} //switch(method)
 		http.Error(res, "CRUD: Create with POST, Read with GET, Update with PUT, Delete with DELETE.", http.StatusMethodNotAllowed)
 		return
 	} //handlerFunc()
 } //Server.storeHandler()
 
+//isCollectionPath reports whether path addresses the store's collection (no id), e.g. "/item" or "/item/"
+func isCollectionPath(path, name string) bool {
+	return path == "/"+name || path == "/"+name+"/"
+}
+
 //POST /item {...} to create a new item -> {"type":"<store.name>", "id":"<id>", "rev":<rev>, "ts":"<ts>", "user":"<user.id>"}
 func (server Server) storePost(s store.IStore, res http.ResponseWriter, req *http.Request) {
 	if req.URL.Path != "/"+s.Name() {
@@ -95,42 +136,28 @@ func (server Server) storePost(s store.IStore, res http.ResponseWriter, req *htt
 	}
 
 	itemPtrValue := reflect.New(s.Type())
-	if err := json.NewDecoder(req.Body).Decode(itemPtrValue.Interface()); err != nil {
-		http.Error(res, fmt.Sprintf("Cannot parse body as JSON %s", s.Name()), http.StatusBadRequest)
+	if err := server.decodeBody(req, itemPtrValue.Interface()); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	itemDataPtr := itemPtrValue.Interface()
-	if itemValidator, ok := itemDataPtr.(IWithValidate); ok {
-		//call validate with pointer receiver
-		if err := itemValidator.Validate(); err != nil {
-			http.Error(res, errors.Wrapf(err, "invalid %s", s.Name()).Error(), http.StatusBadRequest)
-			return
-		}
+	if fields := validate(itemPtrValue.Interface()); len(fields) > 0 {
+		writeValidationError(res, fields)
+		return
 	}
 
 	itemData := itemPtrValue.Elem().Interface()
-	if itemValidator, ok := itemData.(IWithValidate); ok {
-		//call validate with const receiver
-		if err := itemValidator.Validate(); err != nil {
-			http.Error(res, errors.Wrapf(err, "invalid %s", s.Name()).Error(), http.StatusBadRequest)
-			return
-		}
-	}
-
 	info, err := s.Add(itemData)
 	if err != nil {
 		http.Error(res, errors.Wrapf(err, "failed to add").Error(), http.StatusInternalServerError)
 		return
 	}
 
-	jsonValue, _ := json.Marshal(info)
 	res.Header().Set("Item-ID", string(info.ID))
 	res.Header().Set("Item-User-ID", string(info.UserID))
 	res.Header().Set("Item-Timestamp", fmt.Sprintf("%s", info.Timestamp.Format(timestampFormat)))
 	res.Header().Set("Item-Revision", fmt.Sprintf("%d", info.Rev))
-	res.Header().Set("Content-Type", "application/json")
-	res.Write(jsonValue)
+	server.writeBody(res, req, http.StatusOK, info)
 } //Server.storePost()
 
 //GET /item/id -> item data
@@ -150,15 +177,298 @@ func (server Server) storeGet(s store.IStore, res http.ResponseWriter, req *http
 
 	res.Header().Set("Item-Timestamp", fmt.Sprintf("%s", info.Timestamp.Format(timestampFormat)))
 	res.Header().Set("Item-Revision", fmt.Sprintf("%d", info.Rev))
-	res.Header().Set("Content-Type", "application/json")
-	jsonValue, _ := json.Marshal(v)
-	res.Write(jsonValue)
+	server.writeBody(res, req, http.StatusOK, v)
 } //server.storeGet()
 
+//GET /item[?limit=&offset=&cursor=&sort=&filter=] -> paginated, filtered, sorted collection
+func (server Server) storeList(s store.IStore, res http.ResponseWriter, req *http.Request) {
+	queryableStore, ok := s.(IQueryableStore)
+	if !ok {
+		http.Error(res, fmt.Sprintf("%s does not support listing", s.Name()), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+	page, err := pageFromQuery(query)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sort, err := sortFromQuery(query)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := filtersFromQuery(query)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, next, total, err := queryableStore.Find(filter, sort, page)
+	if err != nil {
+		http.Error(res, errors.Wrapf(err, "failed to list %s", s.Name()).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if next != "" {
+		nextQuery := url.Values{}
+		for k, v := range query {
+			nextQuery[k] = v
+		}
+		nextQuery.Set("cursor", next)
+		res.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, (&url.URL{Path: "/" + s.Name(), RawQuery: nextQuery.Encode()}).String()))
+	}
+	server.writeBody(res, req, http.StatusOK, listResponse{Items: items, Next: next, Total: total})
+} //Server.storeList()
+
+//listResponse is the body of a successful GET /item collection request
+type listResponse struct {
+	Items []interface{} `json:"items"`
+	Next  string        `json:"next,omitempty"`
+	Total int           `json:"total"`
+}
+
+const defaultPageLimit = 100
+
+//pageFromQuery parses ?limit=&offset=&cursor=
+func pageFromQuery(query url.Values) (Page, error) {
+	page := Page{Limit: defaultPageLimit, Cursor: query.Get("cursor")}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			return Page{}, errors.Errorf("invalid limit %q", limitStr)
+		}
+		page.Limit = limit
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return Page{}, errors.Errorf("invalid offset %q", offsetStr)
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+//sortFromQuery parses ?sort=field,-otherfield into field order, "-" prefix meaning descending
+func sortFromQuery(query url.Values) ([]SortField, error) {
+	sortParam := query.Get("sort")
+	if sortParam == "" {
+		return nil, nil
+	}
+	terms := strings.Split(sortParam, ",")
+	sort := make([]SortField, 0, len(terms))
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		if strings.HasPrefix(term, "-") {
+			sort = append(sort, SortField{Field: term[1:], Desc: true})
+		} else {
+			sort = append(sort, SortField{Field: term})
+		}
+	}
+	return sort, nil
+}
+
+//filtersFromQuery parses one or more ?filter=field:op:value terms
+func filtersFromQuery(query url.Values) ([]Filter, error) {
+	raw := query["filter"]
+	filters := make([]Filter, 0, len(raw))
+	for _, term := range raw {
+		parts := strings.SplitN(term, ":", 3)
+		if len(parts) != 3 {
+			return nil, errors.Errorf(`invalid filter %q, expecting "field:op:value"`, term)
+		}
+		op := FilterOp(parts[1])
+		switch op {
+		case FilterOpEQ, FilterOpNE, FilterOpLT, FilterOpGT, FilterOpContains, FilterOpIn:
+		default:
+			return nil, errors.Errorf("invalid filter operator %q", parts[1])
+		}
+		filters = append(filters, Filter{Field: parts[0], Op: op, Value: parts[2]})
+	}
+	return filters, nil
+}
+
+//Filter is one parsed "field:op:value" term of the ?filter= query parameter
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value string
+}
+
+//FilterOp is the comparison used by a Filter
+type FilterOp string
+
+//Supported FilterOp values
+const (
+	FilterOpEQ       FilterOp = "eq"
+	FilterOpNE       FilterOp = "ne"
+	FilterOpLT       FilterOp = "lt"
+	FilterOpGT       FilterOp = "gt"
+	FilterOpContains FilterOp = "contains"
+	FilterOpIn       FilterOp = "in"
+)
+
+//SortField is one term of the ?sort= query parameter
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+//Page describes the requested slice of a collection, either offset-based or cursor-based
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+//IQueryableStore is implemented by a store.IStore that also supports paginated,
+//filtered and sorted listing
+type IQueryableStore interface {
+	//Find returns the matching items, a non-empty next cursor when more results remain, and the total match count
+	Find(filter []Filter, sort []SortField, page Page) (items []interface{}, next string, total int, err error)
+}
+
+//PUT /item/id {...} to update an existing item; the "If-Match" header must carry the
+//item's current revision (as returned in "Item-Revision" by POST/GET). A missing or
+//non-numeric "If-Match" is 400 Bad Request; a stale revision, reported by Update with
+//an IConflictError, is 409 Conflict
+func (server Server) storePut(s store.IStore, res http.ResponseWriter, req *http.Request) {
+	parts := strings.SplitN(req.URL.Path, "/", 4)
+	if len(parts) != 3 || len(parts[2]) == 0 {
+		http.Error(res, fmt.Sprintf("Expecting PUT /%s/<id>", s.Name()), http.StatusNotFound)
+		return
+	}
+	id := parts[2]
+
+	rev, err := revisionFromHeader(req.Header)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updatableStore, ok := s.(IUpdatableStore)
+	if !ok {
+		http.Error(res, fmt.Sprintf("%s does not support update", s.Name()), http.StatusMethodNotAllowed)
+		return
+	}
+
+	itemPtrValue := reflect.New(s.Type())
+	if err := server.decodeBody(req, itemPtrValue.Interface()); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if fields := validate(itemPtrValue.Interface()); len(fields) > 0 {
+		writeValidationError(res, fields)
+		return
+	}
+
+	itemData := itemPtrValue.Elem().Interface()
+	info, err := updatableStore.Update(store.ID(id), rev, itemData)
+	if err != nil {
+		if isConflict(err) {
+			http.Error(res, errors.Wrapf(err, "revision %d is stale", rev).Error(), http.StatusConflict)
+			return
+		}
+		http.Error(res, errors.Wrapf(err, "failed to update").Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Item-Timestamp", fmt.Sprintf("%s", info.Timestamp.Format(timestampFormat)))
+	res.Header().Set("Item-Revision", fmt.Sprintf("%d", info.Rev))
+	res.WriteHeader(http.StatusOK)
+} //Server.storePut()
+
+//DELETE /item/id to remove an existing item; the "If-Match" header must carry the
+//item's current revision. A missing or non-numeric "If-Match" is 400 Bad Request; a
+//stale revision, reported by Delete with an IConflictError, is 409 Conflict
+func (server Server) storeDelete(s store.IStore, res http.ResponseWriter, req *http.Request) {
+	parts := strings.SplitN(req.URL.Path, "/", 4)
+	if len(parts) != 3 || len(parts[2]) == 0 {
+		http.Error(res, fmt.Sprintf("Expecting DELETE /%s/<id>", s.Name()), http.StatusNotFound)
+		return
+	}
+	id := parts[2]
+
+	rev, err := revisionFromHeader(req.Header)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deletableStore, ok := s.(IDeletableStore)
+	if !ok {
+		http.Error(res, fmt.Sprintf("%s does not support delete", s.Name()), http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := deletableStore.Delete(store.ID(id), rev)
+	if err != nil {
+		if isConflict(err) {
+			http.Error(res, errors.Wrapf(err, "revision %d is stale", rev).Error(), http.StatusConflict)
+			return
+		}
+		http.Error(res, errors.Wrapf(err, "failed to delete").Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Item-Revision", fmt.Sprintf("%d", info.Rev))
+	res.WriteHeader(http.StatusOK)
+} //Server.storeDelete()
+
+//revisionFromHeader parses the "If-Match" header carrying the caller's last-known revision
+func revisionFromHeader(header http.Header) (int, error) {
+	value := strings.Trim(header.Get("If-Match"), `"`)
+	if value == "" {
+		return 0, errors.Errorf(`missing required "If-Match" header with the item's current revision`)
+	}
+	rev, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, `invalid "If-Match" header %q`, value)
+	}
+	return rev, nil
+}
+
+//isConflict reports whether err signals a stale-revision conflict rather than some other failure
+func isConflict(err error) bool {
+	conflictErr, ok := err.(IConflictError)
+	return ok && conflictErr.Conflict()
+}
+
+//IUpdatableStore is implemented by a store.IStore that also supports optimistic-concurrency updates
+type IUpdatableStore interface {
+	Update(id store.ID, rev int, v interface{}) (store.Info, error)
+}
+
+//IDeletableStore is implemented by a store.IStore that also supports optimistic-concurrency deletes
+type IDeletableStore interface {
+	Delete(id store.ID, rev int) (store.Info, error)
+}
+
+//IConflictError may be implemented by an error returned from IUpdatableStore.Update or
+//IDeletableStore.Delete to signal that the caller's revision was stale rather than some
+//other failure
+type IConflictError interface {
+	error
+	Conflict() bool
+}
+
+//IOper marks a value registered with WithOper(). Its actual shape (a Process(request)
+//(response, error) method with arbitrary request/response types) can't be expressed as
+//a Go interface, so WithOper verifies it by reflection instead; IOper only documents
+//intent at the call site.
+type IOper interface{}
+
 type operInfo struct {
 	oper          IOper
 	processMethod reflect.Value
 	requestType   reflect.Type
+	responseType  reflect.Type
 }
 
 func (server Server) operHandler(
@@ -180,28 +490,16 @@ func (server Server) operHandler(
 //POST /path {...} to call the operation
 func (server Server) operPost(o operInfo, res http.ResponseWriter, req *http.Request) {
 	requestPtrValue := reflect.New(o.requestType)
-	if err := json.NewDecoder(req.Body).Decode(requestPtrValue.Interface()); err != nil {
-		http.Error(res, fmt.Sprintf("Cannot parse body as JSON %s", o.requestType.Name()), http.StatusBadRequest)
+	if err := server.decodeBody(req, requestPtrValue.Interface()); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	requestDataPtr := requestPtrValue.Interface()
-	if requestValidator, ok := requestDataPtr.(IWithValidate); ok {
-		//call validate with pointer receiver
-		if err := requestValidator.Validate(); err != nil {
-			http.Error(res, errors.Wrapf(err, "invalid %s", o.requestType.Name()).Error(), http.StatusBadRequest)
-			return
-		}
+	if fields := validate(requestPtrValue.Interface()); len(fields) > 0 {
+		writeValidationError(res, fields)
+		return
 	}
-
 	requestData := requestPtrValue.Elem().Interface()
-	if requestValidator, ok := requestData.(IWithValidate); ok {
-		//call validate with const receiver
-		if err := requestValidator.Validate(); err != nil {
-			http.Error(res, errors.Wrapf(err, "invalid %s", o.requestType.Name()).Error(), http.StatusBadRequest)
-			return
-		}
-	}
 
 	//call the oper.Process() method to make the response
 	in := make([]reflect.Value, 0)
@@ -223,9 +521,7 @@ func (server Server) operPost(o operInfo, res http.ResponseWriter, req *http.Req
 		http.Error(res, errors.Errorf("failed: %v", err).Error(), http.StatusBadRequest)
 		return
 	}
-	jsonValue, _ := json.Marshal(responseData)
-	res.Header().Set("Content-Type", "application/json")
-	res.Write(jsonValue)
+	server.writeBody(res, req, http.StatusOK, responseData)
 } //Server.operPost()
 
 const timestampFormat = "2006-01-02 15:04:05-0700"
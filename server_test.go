@@ -0,0 +1,241 @@
+package crud
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/store"
+)
+
+//testItem is the store.IStore item type used by fakeStore; it has no "validate" tags
+//so these tests exercise the revision logic without tripping over validate()
+type testItem struct {
+	Name string `json:"name"`
+}
+
+//fakeStore is a minimal in-memory store.IStore, also implementing IUpdatableStore and
+//IDeletableStore, used to exercise storePut/storeDelete's optimistic-concurrency logic
+//without a real backing store
+type fakeStore struct {
+	mu     sync.Mutex
+	items  map[store.ID]*fakeRecord
+	nextID int
+}
+
+type fakeRecord struct {
+	value interface{}
+	info  store.Info
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{items: make(map[store.ID]*fakeRecord)}
+}
+
+func (s *fakeStore) Name() string       { return "item" }
+func (s *fakeStore) Type() reflect.Type { return reflect.TypeOf(testItem{}) }
+
+func (s *fakeStore) Add(v interface{}) (store.Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	info := store.Info{ID: store.ID(strconv.Itoa(s.nextID)), Rev: 1, Timestamp: time.Now()}
+	s.items[info.ID] = &fakeRecord{value: v, info: info}
+	return info, nil
+}
+
+func (s *fakeStore) Get(id store.ID) (interface{}, store.Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.items[id]
+	if !ok {
+		return nil, store.Info{}, fmt.Errorf("%s not found", id)
+	}
+	return record.value, record.info, nil
+}
+
+//Find implements IQueryableStore, returning every item in Add order; it reports a
+//fixed "next" cursor whenever the caller didn't already pass one, so tests can
+//exercise the rel="next" Link header without a real pagination cursor scheme
+func (s *fakeStore) Find(filter []Filter, sort []SortField, page Page) ([]interface{}, string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []interface{}
+	for i := 1; i <= s.nextID; i++ {
+		record, ok := s.items[store.ID(strconv.Itoa(i))]
+		if ok {
+			items = append(items, record.value)
+		}
+	}
+	next := ""
+	if page.Cursor == "" {
+		next = "next-page"
+	}
+	return items, next, len(items), nil
+}
+
+//fakeConflictError implements IConflictError to signal a stale revision
+type fakeConflictError struct{ msg string }
+
+func (e fakeConflictError) Error() string  { return e.msg }
+func (e fakeConflictError) Conflict() bool { return true }
+
+func (s *fakeStore) Update(id store.ID, rev int, v interface{}) (store.Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.items[id]
+	if !ok {
+		return store.Info{}, fmt.Errorf("%s not found", id)
+	}
+	if record.info.Rev != rev {
+		return store.Info{}, fakeConflictError{msg: fmt.Sprintf("revision %d does not match current revision %d", rev, record.info.Rev)}
+	}
+	record.value = v
+	record.info.Rev++
+	record.info.Timestamp = time.Now()
+	return record.info, nil
+}
+
+func (s *fakeStore) Delete(id store.ID, rev int) (store.Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.items[id]
+	if !ok {
+		//already deleted by a concurrent caller: from the caller's perspective its
+		//revision is just as stale as a mismatched one
+		return store.Info{}, fakeConflictError{msg: fmt.Sprintf("%s no longer exists", id)}
+	}
+	if record.info.Rev != rev {
+		return store.Info{}, fakeConflictError{msg: fmt.Sprintf("revision %d does not match current revision %d", rev, record.info.Rev)}
+	}
+	delete(s.items, id)
+	return record.info, nil
+}
+
+func TestStorePutStaleRevisionConflicts(t *testing.T) {
+	fake := newFakeStore()
+	server := New().With(fake)
+
+	info, err := fake.Add(testItem{Name: "before"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/item/"+string(info.ID), strings.NewReader(`{"name":"after"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", strconv.Itoa(info.Rev+1))
+	res := httptest.NewRecorder()
+	server.storePut(fake, res, req)
+
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a stale revision, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+//TestConcurrentUpdateRace fires many PUTs at the same item and revision concurrently;
+//exactly one must win (200) and every other caller must see its revision go stale (409),
+//never a lost update and never two callers both succeeding against the same revision
+func TestConcurrentUpdateRace(t *testing.T) {
+	fake := newFakeStore()
+	server := New().With(fake)
+
+	info, err := fake.Add(testItem{Name: "before"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	const concurrency = 20
+	codes := make([]int, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPut, "/item/"+string(info.ID), strings.NewReader(fmt.Sprintf(`{"name":"updated-%d"}`, i)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", strconv.Itoa(info.Rev))
+			res := httptest.NewRecorder()
+			server.storePut(fake, res, req)
+			codes[i] = res.Code
+		}(i)
+	}
+	wg.Wait()
+
+	var won, conflicted int
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			won++
+		case http.StatusConflict:
+			conflicted++
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("expected exactly one update to win the race, got %d of %d", won, concurrency)
+	}
+	if conflicted != concurrency-1 {
+		t.Fatalf("expected every other update to conflict, got %d of %d", conflicted, concurrency-1)
+	}
+
+	_, finalInfo, err := fake.Get(info.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if finalInfo.Rev != info.Rev+1 {
+		t.Fatalf("expected exactly one revision bump from %d, got %d", info.Rev, finalInfo.Rev)
+	}
+}
+
+//TestConcurrentDeleteRace mirrors TestConcurrentUpdateRace for DELETE: only the first
+//caller to present the current revision may succeed, the rest must see a conflict
+func TestConcurrentDeleteRace(t *testing.T) {
+	fake := newFakeStore()
+	server := New().With(fake)
+
+	info, err := fake.Add(testItem{Name: "before"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	const concurrency = 20
+	codes := make([]int, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodDelete, "/item/"+string(info.ID), nil)
+			req.Header.Set("If-Match", strconv.Itoa(info.Rev))
+			res := httptest.NewRecorder()
+			server.storeDelete(fake, res, req)
+			codes[i] = res.Code
+		}(i)
+	}
+	wg.Wait()
+
+	var deleted, conflicted int
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			deleted++
+		case http.StatusConflict:
+			conflicted++
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if deleted != 1 {
+		t.Fatalf("expected exactly one delete to win the race, got %d of %d", deleted, concurrency)
+	}
+	if conflicted != concurrency-1 {
+		t.Fatalf("expected every other delete to conflict, got %d of %d", conflicted, concurrency-1)
+	}
+}
@@ -0,0 +1,192 @@
+package crud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//IWithValidateDetailed is an alternative to IWithValidate for callers that want to
+//report more than one failure at a time, with a path identifying which field failed
+type IWithValidateDetailed interface {
+	ValidateDetailed() []FieldError
+}
+
+//FieldError describes one failed validation rule
+type FieldError struct {
+	Path    string `json:"path"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+//validationErrorResponse is the body of a 422 response from storePost/storePut/operPost
+type validationErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+//writeValidationError writes the standard {"error":"validation_failed","fields":[...]} response
+func writeValidationError(res http.ResponseWriter, fields []FieldError) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(res).Encode(validationErrorResponse{
+		Error:  "validation_failed",
+		Fields: fields,
+	})
+}
+
+//validate runs the built-in `validate:"..."` struct-tag checks over itemDataPtr (a
+//pointer to the decoded struct), then any IWithValidateDetailed/IWithValidate it
+//implements, combining everything into field-level errors. itemDataPtr's method set
+//already includes value-receiver methods, so checking the pointer once is enough -
+//checking the dereferenced value too would double-report value-receiver validators.
+func validate(itemDataPtr interface{}) []FieldError {
+	fields := validateStructTags(itemDataPtr)
+	fields = append(fields, runCustomValidator(itemDataPtr)...)
+	return fields
+}
+
+func runCustomValidator(v interface{}) []FieldError {
+	if detailedValidator, ok := v.(IWithValidateDetailed); ok {
+		return detailedValidator.ValidateDetailed()
+	}
+	if validator, ok := v.(IWithValidate); ok {
+		if err := validator.Validate(); err != nil {
+			return []FieldError{{Message: err.Error()}}
+		}
+	}
+	return nil
+}
+
+//validateStructTags checks every `validate:"rule,rule=param,..."` struct tag on v (a
+//struct or pointer to struct), supporting "required", "min=N", "max=N" and "email", and
+//recurses into nested structs and slices/arrays of structs, e.g. a "required" tag on
+//Request.User.Email is reported with Path "user.email"
+func validateStructTags(v interface{}) []FieldError {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	return validateStructFields(value, "")
+}
+
+func validateStructFields(value reflect.Value, pathPrefix string) []FieldError {
+	var fields []FieldError
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { //unexported
+			continue
+		}
+		fieldValue := value.Field(i)
+		path := pathPrefix + jsonFieldName(field)
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, rule := range strings.Split(tag, ",") {
+				if message := checkRule(rule, fieldValue); message != "" {
+					fields = append(fields, FieldError{Path: path, Rule: ruleName(rule), Message: message})
+				}
+			}
+		}
+		fields = append(fields, validateNestedField(fieldValue, path+".")...)
+	}
+	return fields
+}
+
+//validateNestedField recurses into fieldValue when it (or, for a slice/array, its
+//elements) is a struct, so "validate" tags on nested fields are checked too
+func validateNestedField(fieldValue reflect.Value, pathPrefix string) []FieldError {
+	for fieldValue.Kind() == reflect.Ptr {
+		if fieldValue.IsNil() {
+			return nil
+		}
+		fieldValue = fieldValue.Elem()
+	}
+	switch fieldValue.Kind() {
+	case reflect.Struct:
+		if fieldValue.Type() == reflect.TypeOf(time.Time{}) {
+			return nil
+		}
+		return validateStructFields(fieldValue, pathPrefix)
+	case reflect.Slice, reflect.Array:
+		var fields []FieldError
+		for i := 0; i < fieldValue.Len(); i++ {
+			fields = append(fields, validateNestedField(fieldValue.Index(i), fmt.Sprintf("%s%d.", pathPrefix, i))...)
+		}
+		return fields
+	default:
+		return nil
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	if jsonTag := field.Tag.Get("json"); jsonTag != "" {
+		if name := strings.SplitN(jsonTag, ",", 2)[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func ruleName(rule string) string {
+	return strings.SplitN(rule, "=", 2)[0]
+}
+
+func ruleParam(rule string) string {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+var emailPattern = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+
+func checkRule(rule string, field reflect.Value) string {
+	switch ruleName(rule) {
+	case "required":
+		if field.IsZero() {
+			return "is required"
+		}
+	case "min":
+		n, err := strconv.Atoi(ruleParam(rule))
+		if err == nil && ruleLen(field) < n {
+			return fmt.Sprintf("must be at least %d", n)
+		}
+	case "max":
+		n, err := strconv.Atoi(ruleParam(rule))
+		if err == nil && ruleLen(field) > n {
+			return fmt.Sprintf("must be at most %d", n)
+		}
+	case "email":
+		if field.Kind() == reflect.String && field.String() != "" && !emailPattern.MatchString(field.String()) {
+			return "must be a valid email address"
+		}
+	}
+	return ""
+}
+
+//ruleLen is the length used by "min"/"max": string/slice/array/map length, or the value
+//of an integer field itself; any other kind, floats included, counts as 0
+func ruleLen(field reflect.Value) int {
+	switch field.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return field.Len()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(field.Uint())
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,111 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/log"
+	"github.com/go-msvc/store"
+)
+
+//Event is one change published on a store's Watch() channel
+type Event struct {
+	Type string      `json:"type"` //"add", "update" or "delete"
+	ID   store.ID    `json:"id"`
+	Rev  int         `json:"rev"`
+	Item interface{} `json:"item,omitempty"`
+}
+
+//IWatchableStore is implemented by a store.IStore that also supports streaming change
+//notifications, similar in spirit to etcd's watch on a keys prefix
+type IWatchableStore interface {
+	//Watch streams every change since sinceRev (0 meaning "from now"). The channel is
+	//closed once ctx is done.
+	Watch(ctx context.Context, sinceRev int) (<-chan Event, error)
+}
+
+const watchHeartbeatInterval = 15 * time.Second
+
+//GET /item?watch=1 -> upgrades to a Server-Sent Events stream of the store's changes.
+//Resume from a given revision with "Last-Event-ID" or "?since_rev=".
+func (server Server) storeWatch(s store.IStore, res http.ResponseWriter, req *http.Request) {
+	watchableStore, ok := s.(IWatchableStore)
+	if !ok {
+		http.Error(res, fmt.Sprintf("%s does not support watch", s.Name()), http.StatusMethodNotAllowed)
+		return
+	}
+
+	sinceRev, err := sinceRevFromRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		http.Error(res, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := req.Context()
+	events, err := watchableStore.Watch(ctx, sinceRev)
+	if err != nil {
+		http.Error(res, errors.Wrapf(err, "failed to watch %s", s.Name()).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return //client disconnected
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			jsonValue, err := json.Marshal(event)
+			if err != nil {
+				log.Errorf("failed to marshal watch event on %s: %v", s.Name(), err)
+				continue
+			}
+			fmt.Fprintf(res, "id: %d\ndata: %s\n\n", event.Rev, jsonValue)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(res, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	} //for(events)
+} //Server.storeWatch()
+
+//sinceRevFromRequest honors "Last-Event-ID" (for the browser EventSource auto-resume
+//case), falling back to "?since_rev="
+func sinceRevFromRequest(req *http.Request) (int, error) {
+	if lastEventID := req.Header.Get("Last-Event-ID"); lastEventID != "" {
+		rev, err := strconv.Atoi(lastEventID)
+		if err != nil {
+			return 0, errors.Wrapf(err, `invalid "Last-Event-ID" header %q`, lastEventID)
+		}
+		return rev, nil
+	}
+	if sinceRevParam := req.URL.Query().Get("since_rev"); sinceRevParam != "" {
+		rev, err := strconv.Atoi(sinceRevParam)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid since_rev %q", sinceRevParam)
+		}
+		return rev, nil
+	}
+	return 0, nil
+}
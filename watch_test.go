@@ -0,0 +1,105 @@
+package crud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//fakeWatchableStore implements store.IStore + IWatchableStore, streaming whatever is
+//pushed onto events until the test closes it; Watch ignores ctx
+type fakeWatchableStore struct {
+	*fakeStore
+	events chan Event
+}
+
+func newFakeWatchableStore() *fakeWatchableStore {
+	return &fakeWatchableStore{fakeStore: newFakeStore(), events: make(chan Event)}
+}
+
+func (s *fakeWatchableStore) Watch(ctx context.Context, sinceRev int) (<-chan Event, error) {
+	return s.events, nil
+}
+
+func TestStoreWatchStreamsEventsAsSSE(t *testing.T) {
+	fake := newFakeWatchableStore()
+	server := New().With(fake)
+
+	req := httptest.NewRequest(http.MethodGet, "/item?watch=1", nil)
+	res := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		server.storeWatch(fake, res, req)
+		close(done)
+	}()
+
+	fake.events <- Event{Type: "add", ID: "1", Rev: 1}
+	close(fake.events)
+	<-done
+
+	if ct := res.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected Content-Type: %q", ct)
+	}
+	body := res.Body.String()
+	if !strings.Contains(body, "id: 1") || !strings.Contains(body, `"type":"add"`) {
+		t.Fatalf("expected the event to be written as SSE, got %q", body)
+	}
+}
+
+func TestStoreWatchRejectsNonWatchableStore(t *testing.T) {
+	fake := newFakeStore()
+	server := New().With(fake)
+
+	req := httptest.NewRequest(http.MethodGet, "/item?watch=1", nil)
+	res := httptest.NewRecorder()
+	server.storeWatch(fake, res, req)
+
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for a store without Watch(), got %d", res.Code)
+	}
+}
+
+func TestSinceRevFromRequestPrefersLastEventID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/item?since_rev=5", nil)
+	req.Header.Set("Last-Event-ID", "9")
+
+	rev, err := sinceRevFromRequest(req)
+	if err != nil {
+		t.Fatalf("sinceRevFromRequest: %v", err)
+	}
+	if rev != 9 {
+		t.Fatalf("expected Last-Event-ID (9) to win over since_rev (5), got %d", rev)
+	}
+}
+
+func TestSinceRevFromRequestFallsBackToQueryParam(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/item?since_rev=5", nil)
+	rev, err := sinceRevFromRequest(req)
+	if err != nil {
+		t.Fatalf("sinceRevFromRequest: %v", err)
+	}
+	if rev != 5 {
+		t.Fatalf("expected since_rev=5, got %d", rev)
+	}
+}
+
+func TestSinceRevFromRequestDefaultsToZero(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/item", nil)
+	rev, err := sinceRevFromRequest(req)
+	if err != nil {
+		t.Fatalf("sinceRevFromRequest: %v", err)
+	}
+	if rev != 0 {
+		t.Fatalf("expected 0 with neither header nor query set, got %d", rev)
+	}
+}
+
+func TestSinceRevFromRequestRejectsInvalidValue(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/item?since_rev=not-a-number", nil)
+	if _, err := sinceRevFromRequest(req); err == nil {
+		t.Fatalf("expected an error for a non-numeric since_rev")
+	}
+}